@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Ahelios/DataRetrievalApp/store"
+)
+
+// errCacheLimitReached is returned by emit once params.Limit records have
+// been sent to the caller. It isn't a real failure: every caller of emit
+// catches it with errors.Is and turns it back into nil, same as a non-cache
+// fetch just stops paging once the Pager hits its own Limit.
+var errCacheLimitReached = errors.New("cache fetch limit reached")
+
+// fetchWithCache streams records the same way pager.Run does, but first
+// serves whatever's already in the cache and only reaches out to the API
+// for (year, month) slices that are missing or past their TTL. Every record
+// it does fetch live is written back into the cache before being emitted.
+// st must already be open; callers share one Store across a whole run (or,
+// for the HTTP server, across its whole lifetime) instead of each reopening
+// the BoltDB file, which takes an exclusive lock per Open.
+func fetchWithCache(ctx context.Context, params Parameters, client *http.Client, st *store.Store) (<-chan DeclaredPerson, <-chan error) {
+	out := make(chan DeclaredPerson, 100)
+	errCh := make(chan error, 1)
+
+	go func() {
+		err := runCachedFetch(ctx, params, client, st, out)
+		close(out)
+		errCh <- err
+		close(errCh)
+	}()
+
+	return out, errCh
+}
+
+func runCachedFetch(ctx context.Context, params Parameters, client *http.Client, st *store.Store, out chan<- DeclaredPerson) error {
+	cached, err := st.Query(params.District, params.Year, params.Month, params.Day)
+	if err != nil {
+		return err
+	}
+
+	// A record can be cached once a slice is fetched and then seen again if
+	// that same slice is re-fetched live (e.g. its TTL lapsed mid-run), so
+	// dedupe on (district_id, id) as we emit.
+	type recordID struct {
+		districtID int
+		id         int
+	}
+	seen := make(map[recordID]bool, len(cached))
+	emitted := 0
+	emit := func(r store.Record) error {
+		key := recordID{districtID: r.DistrictID, id: r.ID}
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		if params.Limit >= 0 && emitted >= params.Limit {
+			return errCacheLimitReached
+		}
+		person := DeclaredPerson{
+			ID: r.ID, Year: r.Year, Month: r.Month, Day: r.Day,
+			Value: r.Value, DistrictID: r.DistrictID, DistrictName: r.DistrictName,
+		}
+		select {
+		case out <- person:
+			emitted++
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for _, r := range cached {
+		if err := emit(r); err != nil {
+			if errors.Is(err, errCacheLimitReached) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	if params.Offline {
+		return nil
+	}
+
+	slices := candidateSlices(params)
+	if slices == nil {
+		// No -year was given, so there's no finite set of slices to check
+		// for staleness: fetch live as usual and just let it warm the
+		// cache for future, narrower queries.
+		if err := fetchLiveIntoCache(ctx, params, client, st, store.Slice{}, false, emit); err != nil && !errors.Is(err, errCacheLimitReached) {
+			return err
+		}
+		return nil
+	}
+
+	missing, err := st.Missing(slices)
+	if err != nil {
+		return err
+	}
+	for _, slice := range missing {
+		if err := fetchLiveIntoCache(ctx, params, client, st, slice, true, emit); err != nil {
+			if errors.Is(err, errCacheLimitReached) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// candidateSlices enumerates the (district, year, month) coverage units a
+// cache-aware fetch should check, given the active filters. It returns nil
+// when there's no year filter to anchor the enumeration on.
+func candidateSlices(params Parameters) []store.Slice {
+	if params.Year <= 0 {
+		return nil
+	}
+
+	months := []int{params.Month}
+	if params.Month <= 0 {
+		months = make([]int, 12)
+		for i := range months {
+			months[i] = i + 1
+		}
+	}
+
+	slices := make([]store.Slice, 0, len(months))
+	for _, month := range months {
+		slices = append(slices, store.Slice{DistrictID: params.District, Year: params.Year, Month: month})
+	}
+	return slices
+}
+
+// fetchLiveIntoCache fetches one slice (or, when markCoverage is false, the
+// query as given in params) straight from the API, writing every record it
+// gets back into the cache and emitting it to the caller.
+func fetchLiveIntoCache(ctx context.Context, params Parameters, client *http.Client, st *store.Store, slice store.Slice, markCoverage bool, emit func(store.Record) error) error {
+	sliceParams := params
+	sliceParams.Resume = ""
+	if markCoverage {
+		// This is a real bounded (year, month) slice that gets marked fresh
+		// below, so fetch all of it regardless of -limit or cache coverage
+		// would be incomplete next time the slice is considered fresh.
+		sliceParams.Limit = -1
+		sliceParams.Year = slice.Year
+		sliceParams.Month = slice.Month
+	}
+
+	pager, err := NewPager(client, sliceParams)
+	if err != nil {
+		return err
+	}
+
+	records, errCh := pager.Run(ctx)
+
+	var fetched []store.Record
+	for person := range records {
+		fetched = append(fetched, store.Record{
+			ID: person.ID, Year: person.Year, Month: person.Month, Day: person.Day,
+			Value: person.Value, DistrictID: person.DistrictID, DistrictName: person.DistrictName,
+		})
+	}
+	if err := <-errCh; err != nil {
+		return err
+	}
+
+	if len(fetched) > 0 {
+		if err := st.Put(fetched); err != nil {
+			return err
+		}
+	}
+	if markCoverage {
+		if err := st.MarkFresh(slice, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range fetched {
+		if err := emit(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
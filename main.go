@@ -1,17 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/Ahelios/DataRetrievalApp/odata"
+	"github.com/Ahelios/DataRetrievalApp/output"
+	"github.com/Ahelios/DataRetrievalApp/store"
 )
 
 // The base URL for the OData API
@@ -42,20 +51,36 @@ type DeclaredPerson struct {
 
 // Parameters stores all command-line options provided by the user
 type Parameters struct {
-	Source   string // API URL
-	District int    // Required district ID
-	Year     int    // Optional year filter
+	Source    string // API URL
+	District  int    // District ID for a single fetch; set per-district during a -districts batch
+	Districts []int  // Resolved list of district IDs to fetch, from -district and/or -districts
+	Year      int    // Optional year filter
 	Month    int    // Optional month filter
 	Day      int    // Optional day filter
-	Limit    int    // Max number of records to retrieve
+	Limit    int    // Max number of records to retrieve, or -1 for no cap
 	Group    string // Grouping option (y, m, d, ym, yd, md)
-	Out      string // Output JSON filename
+	Out      string // Output filename, or "-" for stdout
+	Format   string // Output format: json, ndjson, csv, md, prom
+
+	PageSize int    // Records requested per $top/$skip page
+	Parallel int    // Number of page fetches to run concurrently
+	Resume   string // Path to a state file tracking the last completed $skip offset
+
+	ServerGroup bool // Push grouping/aggregation to the API via $apply instead of computing it locally
+
+	Cache    string        // Path to a local BoltDB cache database
+	CacheTTL time.Duration // How long cached (district,year,month) coverage stays fresh
+	Offline  bool          // Serve entirely from the cache, no network calls
+	Prune    bool          // Remove cache entries older than CacheTTL and exit
+
+	Serve string // Address to listen on (e.g. ":8080"); empty means run once and exit
 }
 
 // GroupedData represents records grouped by year, month, day or combinations
 type GroupedData struct {
 	GroupKey     string           // Key for the group (e.g., "2019" for year)
-	Records      []DeclaredPerson // Records in this group
+	Records      []DeclaredPerson // Records in this group; empty for server-side groups, which carry a Count instead
+	Count        int              // Number of records in this group
 	Value        int              // Sum of values in this group
 	Change       int              // Change from previous group
 	Max          int              // Maximum value
@@ -65,47 +90,63 @@ type GroupedData struct {
 	MaxIncrease  int              // Maximum increase
 }
 
-// Add a new struct for the JSON output format
-type OutputRecord struct {
-	DistrictName string `json:"district_name"`
-	Year         int    `json:"year,omitempty"`
-	Month        int    `json:"month,omitempty"`
-	Day          int    `json:"day,omitempty"`
-	Value        int    `json:"value"`
-	Change       int    `json:"change"`
-	Max          int    `json:"Max"`
-	Min          int    `json:"Min"`
-	Average      int    `json:"Average"`
-	MaxDrop      int    `json:"Max_drop"`
-	MaxIncrease  int    `json:"Max_increase"`
-}
-
-// GetJSON makes an HTTP GET request and parses the JSON response
-// It takes a URL and a pointer to a struct where the response will be stored
-func GetJSON(url string, data interface{}) error {
+// AggregateRow is one row of a $apply=groupby(...)/aggregate(...) response:
+// the grouping fields requested plus the aggregate values computed for them.
+type AggregateRow struct {
+	Year    int `json:"year"`
+	Month   int `json:"month"`
+	Day     int `json:"day"`
+	Count   int `json:"Count"`
+	Value   int `json:"Value"`
+	Max     int `json:"Max"`
+	Min     int `json:"Min"`
+	Average int `json:"Average"`
+}
+
+// AggregateResponse is the response shape for a $apply query.
+type AggregateResponse struct {
+	Value []AggregateRow `json:"value"`
+}
+
+// District is one row of the API's Districts collection.
+type District struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// DistrictsResponse is the response shape for the Districts collection.
+type DistrictsResponse struct {
+	Value []District `json:"value"`
+}
+
+// GetJSON makes an HTTP GET request through client and parses the JSON response.
+// It returns the HTTP status code alongside the error so callers (namely the
+// pager's retry logic) can tell a transient 5xx/network failure apart from a
+// permanent 4xx one.
+func GetJSON(client *http.Client, url string, data interface{}) (int, error) {
 	// Print the URL for debugging
 	fmt.Println("Requesting data from:", url)
-	
+
 	// Make the HTTP GET request
-	resp, err := http.Get(url)
-	
+	resp, err := client.Get(url)
+
 	// Check if the request failed
 	if err != nil {
 		fmt.Println("HTTP request failed:", err)
-		return err
+		return 0, err
 	}
-	
+
 	// Make sure we close the response body when the function exits
 	// defer means "do this at the end of the function"
 	defer resp.Body.Close()
-	
+
 	// Read the entire response body for debugging
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		fmt.Println("Failed to read response:", err)
-		return err
+		return resp.StatusCode, err
 	}
-	
+
 	// Show a preview of the response
 	preview := string(bodyBytes)
 	if len(preview) > 200 {
@@ -113,22 +154,37 @@ func GetJSON(url string, data interface{}) error {
 	}
 	fmt.Println("Response status:", resp.Status)
 	fmt.Println("Response preview:", preview)
-	
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
 	// Parse the JSON response into the provided data structure
 	err = json.Unmarshal(bodyBytes, data)
 	if err != nil {
 		fmt.Println("Failed to parse JSON:", err)
 	}
-	return err
+	return resp.StatusCode, err
 }
 
-// groupData organizes records based on the grouping option and calculates statistics
-func groupData(records []DeclaredPerson, groupBy string) map[string]GroupedData {
+// groupData consumes records as they stream in from the pager and calculates
+// statistics per group. Reading from a channel instead of a pre-built slice
+// means a run never needs to hold the whole dataset in memory at once.
+// It also reports the total number of records seen and the district name of
+// the first record, since fetchDeclairedPersons no longer has a full slice
+// to pull those from afterwards.
+func groupData(records <-chan DeclaredPerson, groupBy string) (map[string]GroupedData, int, string) {
 	// Create a map to hold our grouped data
 	grouped := make(map[string]GroupedData)
-	
+	total := 0
+	districtName := ""
+
 	// First, group the records and calculate basic stats
-	for _, record := range records {
+	for record := range records {
+		total++
+		if total == 1 {
+			districtName = record.DistrictName
+		}
 		// Convert value string to int
 		recordValue, _ := strconv.Atoi(record.Value)
 		
@@ -184,10 +240,11 @@ func groupData(records []DeclaredPerson, groupBy string) map[string]GroupedData
 	
 	// Calculate averages for each group
 	for key, group := range grouped {
-		if len(group.Records) > 0 {
-			group.Average = group.Value / len(group.Records)
-			grouped[key] = group
+		group.Count = len(group.Records)
+		if group.Count > 0 {
+			group.Average = group.Value / group.Count
 		}
+		grouped[key] = group
 	}
 	
 	// Calculate max increase/drop within each group
@@ -242,23 +299,14 @@ func groupData(records []DeclaredPerson, groupBy string) map[string]GroupedData
 		currGroup.Change = currGroup.Value - prevGroup.Value
 		grouped[keys[i]] = currGroup
 	}
-	
-	return grouped
-}
 
-// fetchDeclairedPersons fetches data from the API based on the parameters
-func fetchDeclairedPersons(params Parameters, client *http.Client) {
-	// Parse the base URL
-	baseURL, err := url.Parse(URL)
-	if err != nil {
-		fmt.Println("Error parsing base URL:", err)
-		return
-	}
-
-	// Query parameters
-	queryParams := url.Values{}
+	return grouped, total, districtName
+}
 
-	// Build $filter clause
+// buildFilterClauses turns the filter-shaped fields of params into a list of
+// OData `$filter` clauses. Shared by the single-page URL builder below and by
+// the pager, which appends its own `$skip`/`$top` on top of the same filters.
+func buildFilterClauses(params Parameters) []string {
 	filterClauses := []string{}
 
 	if params.District > 0 {
@@ -274,152 +322,754 @@ func fetchDeclairedPersons(params Parameters, client *http.Client) {
 		filterClauses = append(filterClauses, fmt.Sprintf("day eq %d", params.Day))
 	}
 
-	if len(filterClauses) > 0 {
+	return filterClauses
+}
+
+// buildQueryURL builds a single page request against params.Source, applying
+// $skip/$top on top of the shared $filter clauses.
+func buildQueryURL(params Parameters, skip, top int) (string, error) {
+	baseURL, err := url.Parse(params.Source)
+	if err != nil {
+		return "", err
+	}
+
+	queryParams := url.Values{}
+
+	if filterClauses := buildFilterClauses(params); len(filterClauses) > 0 {
 		queryParams.Add("$filter", strings.Join(filterClauses, " and "))
 	}
 
-	// Add the $top parameter
-	queryParams.Add("$top", strconv.Itoa(params.Limit))
+	queryParams.Add("$top", strconv.Itoa(top))
+	if skip > 0 {
+		queryParams.Add("$skip", strconv.Itoa(skip))
+	}
 
-	// Encode parameters and append to URL
 	baseURL.RawQuery = queryParams.Encode()
+	return baseURL.String(), nil
+}
 
-	finalURL := baseURL.String()
-	fmt.Println("Using URL:", finalURL)
-	
-	// Get the data
-	var persons DeclaredPersons
-	err = GetJSON(finalURL, &persons)
+// districtsURL derives the URL of the API's Districts collection from the
+// records source, assuming it's a sibling collection under the same service
+// root (e.g. .../service/DeclaredPersons -> .../service/Districts).
+func districtsURL(source string) (string, error) {
+	base, err := url.Parse(source)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		return "", err
+	}
+	base.Path = path.Join(path.Dir(base.Path), "Districts")
+	base.RawQuery = ""
+	return base.String(), nil
+}
+
+// loadDistrictNames fetches the Districts collection once and returns a
+// district_id -> name lookup table. This replaces resolving a district's
+// name off the first matching DeclaredPerson record, which comes back
+// blank whenever that district/period combination has zero records.
+func loadDistrictNames(client *http.Client, source string) (map[int]string, error) {
+	queryURL, err := districtsURL(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp DistrictsResponse
+	if _, err := GetJSON(client, queryURL, &resp); err != nil {
+		return nil, err
+	}
+
+	names := make(map[int]string, len(resp.Value))
+	for _, d := range resp.Value {
+		names[d.ID] = d.Name
+	}
+	return names, nil
+}
+
+// parseDistrictList resolves the -district and -districts command-line
+// values into the set of district IDs a run should fetch. -districts takes
+// a comma-separated list of IDs directly, or an "@path" reference to a file
+// listing one ID per line (blank lines and lines starting with "#" are
+// skipped). -district is a convenience for the common single-district case
+// and is folded into the same list.
+func parseDistrictList(district int, districtsArg string) ([]int, error) {
+	var ids []int
+
+	if districtsArg != "" {
+		raw := districtsArg
+		if strings.HasPrefix(districtsArg, "@") {
+			lines, err := readLines(strings.TrimPrefix(districtsArg, "@"))
+			if err != nil {
+				return nil, fmt.Errorf("reading -districts file: %w", err)
+			}
+			raw = strings.Join(lines, ",")
+		}
+
+		for _, field := range strings.Split(raw, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			id, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid district id %q: %w", field, err)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	if district != 0 {
+		ids = append(ids, district)
+	}
+
+	return dedupeInts(ids), nil
+}
+
+// readLines reads a text file into a slice of non-blank, non-comment lines.
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// dedupeInts removes duplicate values from ids, preserving first-seen order.
+func dedupeInts(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	deduped := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		deduped = append(deduped, id)
+	}
+	return deduped
+}
+
+// errServerGroupUnsupported signals that the endpoint rejected a $apply
+// query (400 Bad Request or 501 Not Implemented), meaning the caller should
+// fall back to the in-memory grouping pipeline instead of treating it as a
+// hard failure.
+var errServerGroupUnsupported = errors.New("server-side grouping not supported by this endpoint")
+
+// groupFields maps a -group option to the OData field names $apply should
+// group by.
+func groupFields(groupBy string) []string {
+	switch groupBy {
+	case "y":
+		return []string{"year"}
+	case "m":
+		return []string{"month"}
+	case "d":
+		return []string{"day"}
+	case "ym":
+		return []string{"year", "month"}
+	case "yd":
+		return []string{"year", "day"}
+	case "md":
+		return []string{"month", "day"}
+	default:
+		return nil
+	}
+}
+
+// buildGroupApply renders the $apply expression for a -group option:
+// groupby over its fields, aggregating a record count alongside the same
+// sum/max/min/average statistics groupData computes locally.
+func buildGroupApply(groupBy string) string {
+	fields := strings.Join(groupFields(groupBy), ",")
+	return fmt.Sprintf(
+		"groupby((%s),aggregate($count as Count,value with sum as Value,value with max as Max,value with min as Min,value with average as Average))",
+		fields,
+	)
+}
+
+// aggregateGroupKey rebuilds the same group key format groupData uses
+// locally, so output built from a $apply response lines up with output
+// built from raw records.
+func aggregateGroupKey(groupBy string, row AggregateRow) string {
+	switch groupBy {
+	case "y":
+		return fmt.Sprintf("%d", row.Year)
+	case "m":
+		return fmt.Sprintf("%d", row.Month)
+	case "d":
+		return fmt.Sprintf("%d", row.Day)
+	case "ym":
+		return fmt.Sprintf("%d-%02d", row.Year, row.Month)
+	case "yd":
+		return fmt.Sprintf("%d-%02d", row.Year, row.Day)
+	case "md":
+		return fmt.Sprintf("%02d-%02d", row.Month, row.Day)
+	default:
+		return "all"
+	}
+}
+
+// fetchServerGrouped asks the API to do the grouping and aggregation via
+// $apply, returning groups in the same shape groupData produces locally.
+// Change between adjacent groups is computed here, same as groupData,
+// since the API only returns per-group aggregates; MaxDrop/MaxIncrease
+// need individual record deltas the aggregate response doesn't carry, so
+// they're left at zero in this mode.
+func fetchServerGrouped(client *http.Client, params Parameters) (map[string]GroupedData, int, error) {
+	query := odata.New(params.Source).Apply(buildGroupApply(params.Group))
+	for _, clause := range buildFilterClauses(params) {
+		query.Filter(clause)
+	}
+
+	queryURL, err := query.Build()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var resp AggregateResponse
+	status, err := GetJSON(client, queryURL, &resp)
+	if err != nil {
+		if status == http.StatusBadRequest || status == http.StatusNotImplemented {
+			return nil, 0, errServerGroupUnsupported
+		}
+		return nil, 0, err
+	}
+
+	grouped := make(map[string]GroupedData, len(resp.Value))
+	total := 0
+	for _, row := range resp.Value {
+		key := aggregateGroupKey(params.Group, row)
+		grouped[key] = GroupedData{
+			GroupKey: key,
+			Count:    row.Count,
+			Value:    row.Value,
+			Max:      row.Max,
+			Min:      row.Min,
+			Average:  row.Average,
+		}
+		total += row.Count
+	}
+
+	keys := make([]string, 0, len(grouped))
+	for k := range grouped {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for i := 1; i < len(keys); i++ {
+		curr := grouped[keys[i]]
+		prev := grouped[keys[i-1]]
+		curr.Change = curr.Value - prev.Value
+		grouped[keys[i]] = curr
+	}
+
+	return grouped, total, nil
+}
+
+// fetchDeclairedPersons fetches data from the API based on the parameters.
+// Retrieval itself is delegated to a Pager, which walks $skip/$top pages
+// (optionally several at once) and streams records back over a channel so
+// datasets larger than a single page never need to be held in memory whole.
+func fetchDeclairedPersons(params Parameters, client *http.Client, st *store.Store) {
+	if len(params.Districts) > 1 {
+		if err := fetchMultiDistrict(context.Background(), params, client, st); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
 		return
 	}
-	
-	fmt.Printf("Found %d matching records\n", len(persons.Value))
-	
-	// Group the data if a grouping option was specified
+	if len(params.Districts) == 1 {
+		params.District = params.Districts[0]
+	}
+
 	if params.Group != "" {
-		// Group the filtered records
-		groupedData := groupData(persons.Value, params.Group)
-		
-		// Print the results
-		fmt.Printf("Found %d groups based on '%s' grouping\n", 
-			len(groupedData), params.Group)
-		
-		// Convert map to slice for easier sorting
-		groups := make([]GroupedData, 0, len(groupedData))
-		for _, group := range groupedData {
-			groups = append(groups, group)
+		names, err := loadDistrictNames(client, params.Source)
+		if err != nil {
+			fmt.Printf("Warning: could not load district names: %v\n", err)
+			names = map[int]string{}
 		}
-		
-		// Sort groups by GroupKey
-		sort.Slice(groups, func(i, j int) bool {
-			return groups[i].GroupKey < groups[j].GroupKey
+
+		groupedData, total, districtName, err := fetchGroupedRecords(context.Background(), params, client, st, names)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Found %d matching records\n", total)
+		printAndSaveGroups(params, groupedData, districtName)
+		return
+	}
+
+	// No grouping: just stream and display individual records.
+	var records <-chan DeclaredPerson
+	var errCh <-chan error
+	if params.Cache != "" {
+		records, errCh = fetchWithCache(context.Background(), params, client, st)
+	} else {
+		pager, err := NewPager(client, params)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		records, errCh = pager.Run(context.Background())
+	}
+
+	// Display individual records as they stream in (limit to 100 printed)
+	const displayLimit = 100
+	total := 0
+	for person := range records {
+		total++
+		if total > displayLimit {
+			continue
+		}
+		fmt.Printf("ID: %d, District: %s (ID: %d), Year: %d, Month: %d, Day: %d, Value: %s\n",
+			person.ID, person.DistrictName, person.DistrictID,
+			person.Year, person.Month, person.Day, person.Value)
+	}
+	if err := <-errCh; err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Found %d matching records\n", total)
+}
+
+// districtGroup is one district's contribution to a multi-district grouped
+// fetch: its resolved name alongside the groups fetchGroupedRecords produced
+// for it.
+type districtGroup struct {
+	district int
+	name     string
+	grouped  map[string]GroupedData
+}
+
+// fetchMultiDistrict fans out one fetch per params.Districts entry, bounded
+// by params.Parallel, sharing the single http.Client across all of them.
+// Without a "+district" grouping suffix, the per-district groups are summed
+// together into one combined total per period. With it, each period's
+// per-district values are kept apart as sub-totals instead of merged.
+func fetchMultiDistrict(ctx context.Context, params Parameters, client *http.Client, st *store.Store) error {
+	names, err := loadDistrictNames(client, params.Source)
+	if err != nil {
+		fmt.Printf("Warning: could not load district names: %v\n", err)
+		names = map[int]string{}
+	}
+
+	if params.Group == "" {
+		return fetchMultiDistrictRaw(ctx, params, client, names, st)
+	}
+
+	pivot := strings.HasSuffix(params.Group, "+district")
+	baseGroup := strings.TrimSuffix(params.Group, "+district")
+
+	groups := make([]districtGroup, len(params.Districts))
+	errs := make([]error, len(params.Districts))
+	totals := make([]int, len(params.Districts))
+
+	sem := make(chan struct{}, max(params.Parallel, 1))
+	var wg sync.WaitGroup
+	for i, district := range params.Districts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i, district int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			districtParams := params
+			districtParams.District = district
+			districtParams.Group = baseGroup
+			// Each district runs concurrently and -resume tracks a single
+			// $skip offset in one state file, so sharing it across districts
+			// would race; disable it per-district the same way cache.go
+			// already does for its own per-slice fetches.
+			districtParams.Resume = ""
+			// params.Parallel also bounds how many districts run at once
+			// (sem above); keeping it on districtParams too would let the
+			// two dimensions multiply (e.g. -parallel 8 with several
+			// districts opening up to 8x8 concurrent page requests), so
+			// each district's own pages are fetched sequentially.
+			districtParams.Parallel = 1
+
+			grouped, total, fetchedName, err := fetchGroupedRecords(ctx, districtParams, client, st, names)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			name := names[district]
+			if name == "" {
+				name = fetchedName
+			}
+			groups[i] = districtGroup{district: district, name: name, grouped: grouped}
+			totals[i] = total
+		}(i, district)
+	}
+	wg.Wait()
+
+	grandTotal := 0
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("district %d: %w", params.Districts[i], err)
+		}
+		grandTotal += totals[i]
+	}
+
+	var outputRecords []output.Record
+	baseParams := params
+	baseParams.Group = baseGroup
+
+	if pivot {
+		for _, dg := range groups {
+			outputRecords = append(outputRecords, buildOutputRecords(baseParams, sortedGroups(dg.grouped), dg.name)...)
+		}
+		sort.Slice(outputRecords, func(i, j int) bool {
+			a, b := outputRecords[i], outputRecords[j]
+			if a.Year != b.Year {
+				return a.Year < b.Year
+			}
+			if a.Month != b.Month {
+				return a.Month < b.Month
+			}
+			if a.Day != b.Day {
+				return a.Day < b.Day
+			}
+			return a.DistrictName < b.DistrictName
 		})
-		
-		// Prepare output records
-		var outputRecords []OutputRecord
-		
-		for _, group := range groups {
-			// Create a new output record
-			record := OutputRecord{
-				DistrictName: persons.Value[0].DistrictName,
-				Value:        group.Value,
-				Change:       group.Change,
-				Max:          group.Max,
-				Min:          group.Min,
-				Average:      group.Average,
-				MaxDrop:      group.MaxDrop,
-				MaxIncrease:  group.MaxIncrease,
+	} else {
+		merged := mergeGroupedByPeriod(groups)
+		outputRecords = buildOutputRecords(baseParams, sortedGroups(merged), combinedDistrictName(groups))
+	}
+
+	fmt.Printf("Found %d matching records across %d district(s)\n", grandTotal, len(params.Districts))
+	for _, record := range outputRecords {
+		fmt.Printf("\nGroup: district=%s year=%d month=%d day=%d\n", record.DistrictName, record.Year, record.Month, record.Day)
+		fmt.Printf("  Value: %d\n", record.Value)
+		fmt.Printf("  Change: %d\n", record.Change)
+		fmt.Printf("  Min: %d\n", record.Min)
+		fmt.Printf("  Max: %d\n", record.Max)
+		fmt.Printf("  Average: %d\n", record.Average)
+	}
+
+	if params.Out != "" {
+		return writeOutput(params, outputRecords)
+	}
+	return nil
+}
+
+// combinedDistrictName joins the resolved district names of a batch fetch
+// into a single human-readable label for the merged (non-pivoted) output.
+func combinedDistrictName(groups []districtGroup) string {
+	names := make([]string, 0, len(groups))
+	for _, dg := range groups {
+		if dg.name != "" {
+			names = append(names, dg.name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// mergeGroupedByPeriod sums several districts' per-period groups into one
+// set of combined totals, recomputing Average and Change the same way
+// groupData does for a single district. MaxDrop/MaxIncrease aren't
+// well-defined across districts sharing a period, so they're left at zero,
+// same as fetchServerGrouped does when it can't compute them either.
+func mergeGroupedByPeriod(groups []districtGroup) map[string]GroupedData {
+	merged := make(map[string]GroupedData)
+
+	for _, dg := range groups {
+		for key, group := range dg.grouped {
+			combined, exists := merged[key]
+			if !exists {
+				combined = GroupedData{GroupKey: key, Min: -1, Max: -1}
 			}
-			
-			// Parse the group key to get year, month, day components
-			if strings.Contains(params.Group, "y") {
-				// Extract year from group key based on format
-				if strings.HasPrefix(group.GroupKey, "20") { // Check if starts with year
-					year, _ := strconv.Atoi(group.GroupKey[:4])
-					record.Year = year
+
+			combined.Value += group.Value
+			combined.Count += group.Count
+			if combined.Min == -1 || group.Min < combined.Min {
+				combined.Min = group.Min
+			}
+			if combined.Max == -1 || group.Max > combined.Max {
+				combined.Max = group.Max
+			}
+			merged[key] = combined
+		}
+	}
+
+	for key, combined := range merged {
+		if combined.Count > 0 {
+			combined.Average = combined.Value / combined.Count
+			merged[key] = combined
+		}
+	}
+
+	keys := make([]string, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i := 1; i < len(keys); i++ {
+		curr := merged[keys[i]]
+		prev := merged[keys[i-1]]
+		curr.Change = curr.Value - prev.Value
+		merged[keys[i]] = curr
+	}
+
+	return merged
+}
+
+// fetchMultiDistrictRaw streams and displays individual records for each
+// requested district, fanned out and bounded by params.Parallel the same
+// way the grouped path is.
+func fetchMultiDistrictRaw(ctx context.Context, params Parameters, client *http.Client, names map[int]string, st *store.Store) error {
+	const displayLimit = 100
+
+	sem := make(chan struct{}, max(params.Parallel, 1))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	grandTotal := 0
+	displayed := 0
+	var firstErr error
+
+	for _, district := range params.Districts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(district int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			districtParams := params
+			districtParams.District = district
+			// See fetchMultiDistrict: -resume can't be shared across
+			// concurrently-fetched districts without racing on its state
+			// file, so disable it per-district.
+			districtParams.Resume = ""
+			// See fetchMultiDistrict: -parallel also bounds district
+			// fan-out (sem above), so keep each district's own page
+			// fetches sequential to avoid multiplying the two.
+			districtParams.Parallel = 1
+
+			var records <-chan DeclaredPerson
+			var errCh <-chan error
+			if districtParams.Cache != "" {
+				records, errCh = fetchWithCache(ctx, districtParams, client, st)
+			} else {
+				pager, err := NewPager(client, districtParams)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					return
 				}
+				records, errCh = pager.Run(ctx)
 			}
-			
-			if strings.Contains(params.Group, "m") {
-				// Extract month from group key based on format
-				if len(group.GroupKey) >= 7 && group.GroupKey[4] == '-' {
-					// Format: YYYY-MM (ym grouping)
-					month, _ := strconv.Atoi(group.GroupKey[5:7])
-					record.Month = month
-				} else if len(group.GroupKey) <= 2 || (len(group.GroupKey) >= 5 && group.GroupKey[2] == '-') {
-					// Format: MM or MM-DD (m or md grouping)
-					month, _ := strconv.Atoi(strings.Split(group.GroupKey, "-")[0])
-					record.Month = month
+
+			name := names[district]
+			for person := range records {
+				mu.Lock()
+				grandTotal++
+				if displayed < displayLimit {
+					displayed++
+					displayName := name
+					if displayName == "" {
+						displayName = person.DistrictName
+					}
+					fmt.Printf("ID: %d, District: %s (ID: %d), Year: %d, Month: %d, Day: %d, Value: %s\n",
+						person.ID, displayName, person.DistrictID,
+						person.Year, person.Month, person.Day, person.Value)
 				}
+				mu.Unlock()
 			}
-			
-			if strings.Contains(params.Group, "d") {
-				// Extract day from group key based on format
-				if strings.Contains(group.GroupKey, "-") {
-					day, _ := strconv.Atoi(strings.Split(group.GroupKey, "-")[1])
-					record.Day = day
-				} else {
-					day, _ := strconv.Atoi(group.GroupKey)
-					record.Day = day
+			if err := <-errCh; err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
 				}
+				mu.Unlock()
 			}
-			
-			outputRecords = append(outputRecords, record)
+		}(district)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	fmt.Printf("Found %d matching records across %d district(s)\n", grandTotal, len(params.Districts))
+	return nil
+}
+
+// fetchGroupedRecords runs the grouped-fetch pipeline -- server-side $apply
+// when requested and supported, otherwise the cache/pager-backed local
+// pipeline -- and returns the resulting groups. It's the one fetch+group
+// entry point shared by the CLI and the HTTP server, so both produce
+// identical results for the same parameters.
+func fetchGroupedRecords(ctx context.Context, params Parameters, client *http.Client, st *store.Store, names map[int]string) (map[string]GroupedData, int, string, error) {
+	if params.Cache == "" && params.ServerGroup {
+		grouped, total, err := fetchServerGrouped(client, params)
+		switch {
+		case err == nil:
+			return grouped, total, names[params.District], nil
+		case errors.Is(err, errServerGroupUnsupported):
+			fmt.Println("Server rejected $apply grouping, falling back to local aggregation")
+		default:
+			return nil, 0, "", err
 		}
-		
-		// Display the data to console
-		for _, group := range groups {
-			fmt.Printf("\nGroup: %s\n", group.GroupKey)
-			fmt.Printf("  Records: %d\n", len(group.Records))
-			fmt.Printf("  Value: %d\n", group.Value)
-			fmt.Printf("  Change: %d\n", group.Change)
-			fmt.Printf("  Min: %d\n", group.Min)
-			fmt.Printf("  Max: %d\n", group.Max)
-			fmt.Printf("  Average: %d\n", group.Average)
-			fmt.Printf("  Max Drop: %d\n", group.MaxDrop)
-			fmt.Printf("  Max Increase: %d\n", group.MaxIncrease)
+	}
+
+	var records <-chan DeclaredPerson
+	var errCh <-chan error
+	if params.Cache != "" {
+		records, errCh = fetchWithCache(ctx, params, client, st)
+	} else {
+		pager, err := NewPager(client, params)
+		if err != nil {
+			return nil, 0, "", err
 		}
-		
-		// Save to JSON file if out parameter is specified
-		if params.Out != "" {
-			err := saveToJSON(params.Out, outputRecords)
-			if err != nil {
-				fmt.Printf("Error saving to JSON: %v\n", err)
+		records, errCh = pager.Run(ctx)
+	}
+
+	grouped, total, districtName := groupData(records, params.Group)
+	if err := <-errCh; err != nil {
+		return nil, 0, "", err
+	}
+	if name := names[params.District]; name != "" {
+		districtName = name
+	}
+	return grouped, total, districtName, nil
+}
+
+// sortedGroups converts groupedData to a slice sorted by GroupKey.
+func sortedGroups(groupedData map[string]GroupedData) []GroupedData {
+	groups := make([]GroupedData, 0, len(groupedData))
+	for _, group := range groupedData {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].GroupKey < groups[j].GroupKey
+	})
+	return groups
+}
+
+// buildOutputRecords converts sorted groups into the canonical output.Record
+// shape, parsing year/month/day back out of each GroupKey.
+func buildOutputRecords(params Parameters, groups []GroupedData, districtName string) []output.Record {
+	var outputRecords []output.Record
+
+	for _, group := range groups {
+		// Create a new output record
+		record := output.Record{
+			DistrictName: districtName,
+			Value:        group.Value,
+			Change:       group.Change,
+			Max:          group.Max,
+			Min:          group.Min,
+			Average:      group.Average,
+			MaxDrop:      group.MaxDrop,
+			MaxIncrease:  group.MaxIncrease,
+		}
+
+		// Parse the group key to get year, month, day components
+		if strings.Contains(params.Group, "y") {
+			// Extract year from group key based on format
+			if strings.HasPrefix(group.GroupKey, "20") { // Check if starts with year
+				year, _ := strconv.Atoi(group.GroupKey[:4])
+				record.Year = year
 			}
 		}
-	} else {
-		// Display individual records (limit to 100)
-		displayLimit := 100
-		if displayLimit > len(persons.Value) {
-			displayLimit = len(persons.Value)
+
+		if strings.Contains(params.Group, "m") {
+			// Extract month from group key based on format
+			if len(group.GroupKey) >= 7 && group.GroupKey[4] == '-' {
+				// Format: YYYY-MM (ym grouping)
+				month, _ := strconv.Atoi(group.GroupKey[5:7])
+				record.Month = month
+			} else if len(group.GroupKey) <= 2 || (len(group.GroupKey) >= 5 && group.GroupKey[2] == '-') {
+				// Format: MM or MM-DD (m or md grouping)
+				month, _ := strconv.Atoi(strings.Split(group.GroupKey, "-")[0])
+				record.Month = month
+			}
 		}
-		
-		for i := 0; i < displayLimit; i++ {
-			person := persons.Value[i]
-			fmt.Printf("ID: %d, District: %s (ID: %d), Year: %d, Month: %d, Day: %d, Value: %s\n",
-				person.ID, person.DistrictName, person.DistrictID, 
-				person.Year, person.Month, person.Day, person.Value)
+
+		if strings.Contains(params.Group, "d") {
+			// Extract day from group key based on format
+			if strings.Contains(group.GroupKey, "-") {
+				day, _ := strconv.Atoi(strings.Split(group.GroupKey, "-")[1])
+				record.Day = day
+			} else {
+				day, _ := strconv.Atoi(group.GroupKey)
+				record.Day = day
+			}
+		}
+
+		outputRecords = append(outputRecords, record)
+	}
+
+	return outputRecords
+}
+
+// printAndSaveGroups prints groupedData to the console in the usual format
+// and writes it to params.Out if set. Shared by the server-side ($apply)
+// and local (groupData) grouping paths so their output stays identical
+// regardless of where the aggregation happened.
+func printAndSaveGroups(params Parameters, groupedData map[string]GroupedData, districtName string) {
+	// Print the results
+	fmt.Printf("Found %d groups based on '%s' grouping\n",
+		len(groupedData), params.Group)
+
+	groups := sortedGroups(groupedData)
+	outputRecords := buildOutputRecords(params, groups, districtName)
+
+	// Display the data to console
+	for _, group := range groups {
+		fmt.Printf("\nGroup: %s\n", group.GroupKey)
+		fmt.Printf("  Records: %d\n", group.Count)
+		fmt.Printf("  Value: %d\n", group.Value)
+		fmt.Printf("  Change: %d\n", group.Change)
+		fmt.Printf("  Min: %d\n", group.Min)
+		fmt.Printf("  Max: %d\n", group.Max)
+		fmt.Printf("  Average: %d\n", group.Average)
+		fmt.Printf("  Max Drop: %d\n", group.MaxDrop)
+		fmt.Printf("  Max Increase: %d\n", group.MaxIncrease)
+	}
+
+	// Write the selected output format if an out parameter is specified
+	if params.Out != "" {
+		if err := writeOutput(params, outputRecords); err != nil {
+			fmt.Printf("Error writing output: %v\n", err)
 		}
 	}
 }
 
-// Add this function to save data to a JSON file
-func saveToJSON(filename string, data []OutputRecord) error {
-	// Create pretty JSON with indentation
-	jsonData, err := json.MarshalIndent(data, "", "  ")
+// writeOutput renders records in params.Format and writes them to params.Out,
+// which may be "-" for stdout or a filename.
+func writeOutput(params Parameters, records []output.Record) error {
+	sink := io.Writer(os.Stdout)
+	if params.Out != "-" {
+		file, err := os.Create(params.Out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		sink = file
+	}
+
+	writer, err := output.New(params.Format, sink)
 	if err != nil {
 		return err
 	}
-	
-	// Write to file using os.WriteFile instead of ioutil.WriteFile
-	err = os.WriteFile(filename, jsonData, 0644)
-	if err != nil {
+	if err := writer.Write(context.Background(), records); err != nil {
 		return err
 	}
-	
-	fmt.Printf("Data successfully exported to %s\n", filename)
+
+	if params.Out != "-" {
+		fmt.Printf("Data successfully exported to %s\n", params.Out)
+	}
 	return nil
 }
 
@@ -427,35 +1077,104 @@ func main() {
 	// Define command-line flags
 	params := Parameters{}
 	
+	var districtsArg string
+
 	flag.StringVar(&params.Source, "source", URL, "Service address")
-	flag.IntVar(&params.District, "district", 0, "District identifier (required)")
+	flag.IntVar(&params.District, "district", 0, "District identifier (required unless -districts is given)")
+	flag.StringVar(&districtsArg, "districts", "", "Comma-separated district identifiers, or @path/to/file.txt with one per line, for a multi-district batch run")
 	flag.IntVar(&params.Year, "year", 0, "Year to filter data")
 	flag.IntVar(&params.Month, "month", 0, "Month to filter data")
 	flag.IntVar(&params.Day, "day", 0, "Day to filter data")
-	flag.IntVar(&params.Limit, "limit", 100, "Maximum number of records to retrieve")
-	flag.StringVar(&params.Group, "group", "", "Grouping option: y, m, d, ym, yd, md")
-	flag.StringVar(&params.Out, "out", "", "Output file name for JSON export")
-	
+	flag.IntVar(&params.Limit, "limit", 100, "Maximum number of records to retrieve, or -1 for all")
+	flag.StringVar(&params.Group, "group", "", "Grouping option: y, m, d, ym, yd, md, optionally suffixed with +district to keep per-district sub-totals apart instead of summing them together")
+	flag.StringVar(&params.Out, "out", "", "Output file name for exported results, or - for stdout")
+	flag.StringVar(&params.Format, "format", "json", "Output format for -out: json, ndjson, csv, md, prom")
+	flag.IntVar(&params.PageSize, "pageSize", 100, "Records requested per $top/$skip page")
+	flag.IntVar(&params.Parallel, "parallel", 1, "Number of page fetches to run concurrently; also bounds how many districts under -districts are fetched concurrently, with each district's own pages then fetched sequentially")
+	flag.StringVar(&params.Resume, "resume", "", "State file tracking the last completed $skip offset, for resuming interrupted runs")
+	flag.BoolVar(&params.ServerGroup, "serverGroup", false, "Push grouping/aggregation to the API via $apply instead of computing it locally")
+	flag.StringVar(&params.Cache, "cache", "", "Path to a local cache database; consult and update it instead of always hitting the API")
+	flag.DurationVar(&params.CacheTTL, "cacheTTL", 24*time.Hour, "How long cached coverage stays fresh before it's re-fetched")
+	flag.BoolVar(&params.Offline, "offline", false, "Serve grouping/statistics entirely from -cache, with no network calls")
+	flag.BoolVar(&params.Prune, "prune", false, "Remove cache entries older than -cacheTTL and exit")
+	flag.StringVar(&params.Serve, "serve", "", "Address to serve /query, /metrics and /healthz on (e.g. :8080), instead of running once")
+
 	// Parse command-line arguments
 	flag.Parse()
-	
+
+	districts, err := parseDistrictList(params.District, districtsArg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	params.Districts = districts
+
 	// TODO: add validation for other params
-	
-	// Validate required parameters
-	if params.District == 0 {
-		fmt.Println("Error: district parameter is required")
-		flag.Usage()
+
+	if params.Prune {
+		if params.Cache == "" {
+			fmt.Println("Error: -cache is required with -prune")
+			return
+		}
+		st, err := store.Open(params.Cache, params.CacheTTL)
+		if err != nil {
+			fmt.Printf("Error opening cache: %v\n", err)
+			return
+		}
+		defer st.Close()
+
+		removed, err := st.Prune(params.CacheTTL)
+		if err != nil {
+			fmt.Printf("Error pruning cache: %v\n", err)
+			return
+		}
+		fmt.Printf("Pruned %d cached record(s)\n", removed)
 		return
 	}
-	
+
+	if params.Offline && params.Cache == "" {
+		fmt.Println("Error: -offline requires -cache")
+		return
+	}
+
 	// Initialize HTTP client
 	client := &http.Client{Timeout: time.Second * 10}
-	
+
+	// Open the cache store once and share it for the life of the run (or,
+	// under -serve, the life of the server), instead of letting every
+	// cache-backed fetch open and close the BoltDB file on its own --
+	// Open takes an exclusive file lock, so reopening per request would
+	// serialize concurrent requests on it.
+	var cacheStore *store.Store
+	if params.Cache != "" {
+		cacheStore, err = store.Open(params.Cache, params.CacheTTL)
+		if err != nil {
+			fmt.Printf("Error opening cache: %v\n", err)
+			return
+		}
+		defer cacheStore.Close()
+	}
+
+	if params.Serve != "" {
+		// Server mode takes district (and the other filters) per-request via
+		// query parameters instead of requiring them on the command line.
+		if err := runServer(params.Serve, params, client, cacheStore); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		return
+	}
+
+	// Validate required parameters
+	if len(params.Districts) == 0 {
+		fmt.Println("Error: -district or -districts is required")
+		flag.Usage()
+		return
+	}
+
 	// Get and process data
-	fetchDeclairedPersons(params, client)
+	fetchDeclairedPersons(params, client, cacheStore)
 
 	// TODO: add better error handling
-	// TODO: make district name lookup table
 
 	/*
 	Old code - keeping for reference
@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+func TestMergeGroupedByPeriodSumsAcrossDistricts(t *testing.T) {
+	groups := []districtGroup{
+		{
+			district: 1,
+			name:     "Centre",
+			grouped: map[string]GroupedData{
+				"2019-03": {GroupKey: "2019-03", Count: 2, Value: 30, Min: 10, Max: 20},
+			},
+		},
+		{
+			district: 2,
+			name:     "North",
+			grouped: map[string]GroupedData{
+				"2019-03": {GroupKey: "2019-03", Count: 1, Value: 5, Min: 5, Max: 5},
+			},
+		},
+	}
+
+	merged := mergeGroupedByPeriod(groups)
+
+	got, ok := merged["2019-03"]
+	if !ok {
+		t.Fatalf("mergeGroupedByPeriod() = %+v, want a \"2019-03\" group", merged)
+	}
+	if got.Value != 35 {
+		t.Errorf("Value = %d, want 35 (30+5)", got.Value)
+	}
+	if got.Count != 3 {
+		t.Errorf("Count = %d, want 3 (2+1)", got.Count)
+	}
+	if got.Average != 11 {
+		t.Errorf("Average = %d, want 11 (35/3)", got.Average)
+	}
+	if got.Min != 5 {
+		t.Errorf("Min = %d, want 5 (min across districts)", got.Min)
+	}
+	if got.Max != 20 {
+		t.Errorf("Max = %d, want 20 (max across districts)", got.Max)
+	}
+}
+
+func TestMergeGroupedByPeriodUsesCountNotRecordsLength(t *testing.T) {
+	// Server-side aggregation never populates Records, only Count -- the
+	// merge must use Count so Average isn't silently left at zero here.
+	groups := []districtGroup{
+		{district: 1, grouped: map[string]GroupedData{
+			"2020": {GroupKey: "2020", Count: 4, Value: 100, Min: 10, Max: 40},
+		}},
+	}
+
+	merged := mergeGroupedByPeriod(groups)
+
+	got, ok := merged["2020"]
+	if !ok {
+		t.Fatalf("mergeGroupedByPeriod() = %+v, want a \"2020\" group", merged)
+	}
+	if len(got.Records) != 0 {
+		t.Fatalf("Records = %+v, want none (server-aggregated input carries no Records)", got.Records)
+	}
+	if got.Average != 25 {
+		t.Errorf("Average = %d, want 25 (100/4 via Count)", got.Average)
+	}
+}
+
+func TestMergeGroupedByPeriodKeepsDistinctPeriodsApart(t *testing.T) {
+	groups := []districtGroup{
+		{district: 1, grouped: map[string]GroupedData{
+			"2019-01": {GroupKey: "2019-01", Count: 1, Value: 10, Min: 10, Max: 10},
+		}},
+		{district: 2, grouped: map[string]GroupedData{
+			"2019-02": {GroupKey: "2019-02", Count: 1, Value: 20, Min: 20, Max: 20},
+		}},
+	}
+
+	merged := mergeGroupedByPeriod(groups)
+
+	if len(merged) != 2 {
+		t.Fatalf("mergeGroupedByPeriod() returned %d groups, want 2 (distinct periods shouldn't merge)", len(merged))
+	}
+}
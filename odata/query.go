@@ -0,0 +1,80 @@
+// Package odata provides a small builder for OData v4 query URLs, so the
+// $filter/$apply/$orderby/$top construction used by the CLI can be tested in
+// isolation from the HTTP and domain-specific code that calls it.
+package odata
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// QueryBuilder incrementally assembles an OData query string against a base
+// collection URL. Zero value is not usable; construct one with New.
+type QueryBuilder struct {
+	base    string
+	filters []string
+	top     int
+	apply   string
+	orderBy string
+}
+
+// New returns a QueryBuilder for the given collection URL, e.g.
+// "https://opendata.riga.lv/odata/service/DeclaredPersons".
+func New(base string) *QueryBuilder {
+	return &QueryBuilder{base: base, top: -1}
+}
+
+// Filter appends an additional $filter clause, ANDed together with any
+// others already added. Empty clauses are ignored so callers can pass
+// conditionally-built strings without an extra check.
+func (q *QueryBuilder) Filter(clause string) *QueryBuilder {
+	if clause != "" {
+		q.filters = append(q.filters, clause)
+	}
+	return q
+}
+
+// Top sets $top. Pass a negative n to leave $top unset.
+func (q *QueryBuilder) Top(n int) *QueryBuilder {
+	q.top = n
+	return q
+}
+
+// Apply sets the $apply transformation expression, e.g.
+// "groupby((year,month),aggregate(value with sum as Value))".
+func (q *QueryBuilder) Apply(expr string) *QueryBuilder {
+	q.apply = expr
+	return q
+}
+
+// OrderBy sets the $orderby expression.
+func (q *QueryBuilder) OrderBy(expr string) *QueryBuilder {
+	q.orderBy = expr
+	return q
+}
+
+// Build renders the accumulated clauses into a full query URL.
+func (q *QueryBuilder) Build() (string, error) {
+	u, err := url.Parse(q.base)
+	if err != nil {
+		return "", err
+	}
+
+	values := url.Values{}
+	if len(q.filters) > 0 {
+		values.Set("$filter", strings.Join(q.filters, " and "))
+	}
+	if q.apply != "" {
+		values.Set("$apply", q.apply)
+	}
+	if q.orderBy != "" {
+		values.Set("$orderby", q.orderBy)
+	}
+	if q.top >= 0 {
+		values.Set("$top", strconv.Itoa(q.top))
+	}
+
+	u.RawQuery = values.Encode()
+	return u.String(), nil
+}
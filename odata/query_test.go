@@ -0,0 +1,83 @@
+package odata
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestQueryBuilderBuild(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func() *QueryBuilder
+		want  url.Values
+	}{
+		{
+			name: "no clauses",
+			build: func() *QueryBuilder {
+				return New("https://example.com/Things")
+			},
+			want: url.Values{},
+		},
+		{
+			name: "filters are ANDed together",
+			build: func() *QueryBuilder {
+				return New("https://example.com/Things").
+					Filter("district_id eq 1").
+					Filter("year eq 2019")
+			},
+			want: url.Values{"$filter": {"district_id eq 1 and year eq 2019"}},
+		},
+		{
+			name: "empty filter is ignored",
+			build: func() *QueryBuilder {
+				return New("https://example.com/Things").Filter("")
+			},
+			want: url.Values{},
+		},
+		{
+			name: "apply and orderby and top",
+			build: func() *QueryBuilder {
+				return New("https://example.com/Things").
+					Apply("groupby((year),aggregate(value with sum as Value))").
+					OrderBy("year").
+					Top(50)
+			},
+			want: url.Values{
+				"$apply":   {"groupby((year),aggregate(value with sum as Value))"},
+				"$orderby": {"year"},
+				"$top":     {"50"},
+			},
+		},
+		{
+			name: "negative top is left unset",
+			build: func() *QueryBuilder {
+				return New("https://example.com/Things").Top(-1)
+			},
+			want: url.Values{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.build().Build()
+			if err != nil {
+				t.Fatalf("Build() returned error: %v", err)
+			}
+
+			u, err := url.Parse(got)
+			if err != nil {
+				t.Fatalf("Build() produced unparseable URL %q: %v", got, err)
+			}
+
+			gotValues := u.Query()
+			if len(gotValues) != len(tt.want) {
+				t.Fatalf("Build() query = %v, want %v", gotValues, tt.want)
+			}
+			for key, want := range tt.want {
+				if got := gotValues.Get(key); got != want[0] {
+					t.Errorf("Build() query[%q] = %q, want %q", key, got, want[0])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package output
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// csvWriter writes records as a CSV table with one header row.
+type csvWriter struct {
+	w io.Writer
+}
+
+var csvHeader = []string{
+	"district_name", "year", "month", "day",
+	"value", "change", "max", "min", "average", "max_drop", "max_increase",
+}
+
+func (c *csvWriter) Write(ctx context.Context, records []Record) error {
+	cw := csv.NewWriter(c.w)
+
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		row := []string{
+			record.DistrictName,
+			strconv.Itoa(record.Year),
+			strconv.Itoa(record.Month),
+			strconv.Itoa(record.Day),
+			strconv.Itoa(record.Value),
+			strconv.Itoa(record.Change),
+			strconv.Itoa(record.Max),
+			strconv.Itoa(record.Min),
+			strconv.Itoa(record.Average),
+			strconv.Itoa(record.MaxDrop),
+			strconv.Itoa(record.MaxIncrease),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,26 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// jsonWriter writes records as a single pretty-printed JSON array, matching
+// the CLI's original -out behavior.
+type jsonWriter struct {
+	w io.Writer
+}
+
+func (j *jsonWriter) Write(ctx context.Context, records []Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
@@ -0,0 +1,60 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// markdownWriter renders records as one Markdown table per district, so a
+// multi-district export reads as a report rather than one giant table.
+type markdownWriter struct {
+	w io.Writer
+}
+
+func (m *markdownWriter) Write(ctx context.Context, records []Record) error {
+	byDistrict := make(map[string][]Record)
+	for _, record := range records {
+		byDistrict[record.DistrictName] = append(byDistrict[record.DistrictName], record)
+	}
+
+	districts := make([]string, 0, len(byDistrict))
+	for district := range byDistrict {
+		districts = append(districts, district)
+	}
+	sort.Strings(districts)
+
+	for _, district := range districts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		heading := district
+		if heading == "" {
+			heading = "(unknown district)"
+		}
+		fmt.Fprintf(m.w, "## %s\n\n", heading)
+		fmt.Fprintln(m.w, "| Year | Month | Day | Value | Change | Max | Min | Average | Max Drop | Max Increase |")
+		fmt.Fprintln(m.w, "|---|---|---|---|---|---|---|---|---|---|")
+
+		for _, record := range byDistrict[district] {
+			fmt.Fprintf(m.w, "| %s | %s | %s | %d | %d | %d | %d | %d | %d | %d |\n",
+				optionalCell(record.Year), optionalCell(record.Month), optionalCell(record.Day),
+				record.Value, record.Change, record.Max, record.Min, record.Average,
+				record.MaxDrop, record.MaxIncrease)
+		}
+		fmt.Fprintln(m.w)
+	}
+
+	return nil
+}
+
+// optionalCell renders a grouping field that may not apply to this record
+// (e.g. Day on a "ym" grouped row) as a blank cell instead of "0".
+func optionalCell(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d", n)
+}
@@ -0,0 +1,26 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// ndjsonWriter writes one JSON object per line, for streaming pipelines that
+// want to consume records incrementally rather than parse one big array.
+type ndjsonWriter struct {
+	w io.Writer
+}
+
+func (n *ndjsonWriter) Write(ctx context.Context, records []Record) error {
+	enc := json.NewEncoder(n.w)
+	for _, record := range records {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// prometheusWriter renders records as Prometheus text exposition format, one
+// gauge family per statistic (value, change, max, min, average).
+type prometheusWriter struct {
+	w io.Writer
+}
+
+const metricPrefix = "riga_declared_persons"
+
+func (p *prometheusWriter) Write(ctx context.Context, records []Record) error {
+	for _, record := range records {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		labels := recordLabels(record)
+		fmt.Fprintf(p.w, "%s_value{%s} %d\n", metricPrefix, labels, record.Value)
+		fmt.Fprintf(p.w, "%s_value_change{%s} %d\n", metricPrefix, labels, record.Change)
+		fmt.Fprintf(p.w, "%s_value_max{%s} %d\n", metricPrefix, labels, record.Max)
+		fmt.Fprintf(p.w, "%s_value_min{%s} %d\n", metricPrefix, labels, record.Min)
+		fmt.Fprintf(p.w, "%s_value_avg{%s} %d\n", metricPrefix, labels, record.Average)
+	}
+	return nil
+}
+
+// recordLabels builds the Prometheus label set for a record, omitting any
+// grouping dimension (year/month/day) that doesn't apply to it.
+func recordLabels(record Record) string {
+	labels := fmt.Sprintf("district=%q", record.DistrictName)
+	if record.Year != 0 {
+		labels += fmt.Sprintf(",year=%q", fmt.Sprintf("%d", record.Year))
+	}
+	if record.Month != 0 {
+		labels += fmt.Sprintf(",month=%q", fmt.Sprintf("%02d", record.Month))
+	}
+	if record.Day != 0 {
+		labels += fmt.Sprintf(",day=%q", fmt.Sprintf("%02d", record.Day))
+	}
+	return labels
+}
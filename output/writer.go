@@ -0,0 +1,68 @@
+// Package output defines the pluggable output formats the CLI can export
+// grouped results to: the Writer interface plus one implementation per
+// supported -format value.
+package output
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Record is the canonical, format-agnostic shape of one exported row. Every
+// Writer implementation consumes the same Record slice, so adding a new
+// format never touches how records are produced.
+type Record struct {
+	DistrictName string `json:"district_name"`
+	Year         int    `json:"year,omitempty"`
+	Month        int    `json:"month,omitempty"`
+	Day          int    `json:"day,omitempty"`
+	Value        int    `json:"value"`
+	Change       int    `json:"change"`
+	Max          int    `json:"Max"`
+	Min          int    `json:"Min"`
+	Average      int    `json:"Average"`
+	MaxDrop      int    `json:"Max_drop"`
+	MaxIncrease  int    `json:"Max_increase"`
+}
+
+// Writer renders a batch of Records to a sink in a particular format.
+type Writer interface {
+	Write(ctx context.Context, records []Record) error
+}
+
+// registry maps a -format value to a constructor for its Writer.
+var registry = map[string]func(io.Writer) Writer{
+	"json":   func(w io.Writer) Writer { return &jsonWriter{w: w} },
+	"ndjson": func(w io.Writer) Writer { return &ndjsonWriter{w: w} },
+	"csv":    func(w io.Writer) Writer { return &csvWriter{w: w} },
+	"md":     func(w io.Writer) Writer { return &markdownWriter{w: w} },
+	"prom":   func(w io.Writer) Writer { return &prometheusWriter{w: w} },
+}
+
+// New returns the Writer registered for format, writing to w.
+func New(format string, w io.Writer) (Writer, error) {
+	factory, ok := registry[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q (supported: %s)", format, supportedFormats())
+	}
+	return factory(w), nil
+}
+
+func supportedFormats() string {
+	formats := make([]string, 0, len(registry))
+	for format := range registry {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	list := ""
+	for i, format := range formats {
+		if i > 0 {
+			list += ", "
+		}
+		list += format
+	}
+	return list
+}
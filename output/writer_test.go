@@ -0,0 +1,58 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNewUnknownFormat(t *testing.T) {
+	if _, err := New("xml", &bytes.Buffer{}); err == nil {
+		t.Fatal("New(\"xml\", ...) expected an error for an unregistered format")
+	}
+}
+
+func TestCSVWriterWritesHeaderAndRows(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := New("csv", &buf)
+	if err != nil {
+		t.Fatalf("New(\"csv\", ...) returned error: %v", err)
+	}
+
+	records := []Record{
+		{DistrictName: "Centre", Year: 2019, Month: 3, Value: 120, Change: 5},
+	}
+	if err := w.Write(context.Background(), records); err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Write() produced %d lines, want 2 (header + 1 row): %q", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[1], "Centre,2019,3,0,120,5") {
+		t.Errorf("Write() row = %q, want it to start with %q", lines[1], "Centre,2019,3,0,120,5")
+	}
+}
+
+func TestPrometheusWriterOmitsZeroDimensions(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := New("prom", &buf)
+	if err != nil {
+		t.Fatalf("New(\"prom\", ...) returned error: %v", err)
+	}
+
+	records := []Record{{DistrictName: "Centre", Year: 2019, Value: 120}}
+	if err := w.Write(context.Background(), records); err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, `riga_declared_persons_value{district="Centre",year="2019"} 120`) {
+		t.Errorf("Write() = %q, missing expected value line", out)
+	}
+	if strings.Contains(out, "month=") || strings.Contains(out, "day=") {
+		t.Errorf("Write() = %q, should omit unset month/day labels", out)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Pagination and retry tuning. These are deliberately conservative constants
+// rather than flags -- the knobs users actually need (page size, fan-out,
+// resume file) are exposed on Parameters instead.
+const (
+	defaultPageSize  = 100
+	maxFetchAttempts = 5
+	baseBackoff      = 200 * time.Millisecond
+	maxBackoff       = 5 * time.Second
+)
+
+// Pager walks an OData collection page by page using $skip/$top, optionally
+// fetching several pages concurrently, and streams the decoded records out
+// over a channel so a run never has to hold the whole dataset in memory.
+type Pager struct {
+	client    *http.Client
+	params    Parameters
+	pageSize  int
+	startSkip int
+}
+
+// NewPager builds a Pager for params, loading the starting $skip offset from
+// params.Resume if one was given and a prior run left state behind.
+func NewPager(client *http.Client, params Parameters) (*Pager, error) {
+	pageSize := params.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	startSkip, err := loadResumeState(params.Resume)
+	if err != nil {
+		return nil, fmt.Errorf("reading resume state: %w", err)
+	}
+
+	return &Pager{
+		client:    client,
+		params:    params,
+		pageSize:  pageSize,
+		startSkip: startSkip,
+	}, nil
+}
+
+// Run starts fetching pages in the background and returns a channel of
+// records plus a channel that carries at most one error. Both channels are
+// closed once fetching stops; the error channel is always safe to receive
+// from (it yields nil on a clean finish) and should be read only after the
+// records channel has been drained.
+func (p *Pager) Run(ctx context.Context) (<-chan DeclaredPerson, <-chan error) {
+	out := make(chan DeclaredPerson, p.pageSize)
+	errCh := make(chan error, 1)
+
+	go func() {
+		var err error
+		if p.params.Parallel > 1 {
+			err = p.runParallel(ctx, out)
+		} else {
+			err = p.runSequential(ctx, out)
+		}
+		close(out)
+		errCh <- err
+		close(errCh)
+	}()
+
+	return out, errCh
+}
+
+// pageTop returns how many records to request for the page starting at skip,
+// capped so the global Limit is never exceeded. The bool is false once skip
+// has already reached the limit and no further pages should be fetched.
+func (p *Pager) pageTop(skip int) (int, bool) {
+	top := p.pageSize
+	if p.params.Limit >= 0 {
+		remaining := p.params.Limit - skip
+		if remaining <= 0 {
+			return 0, false
+		}
+		if remaining < top {
+			top = remaining
+		}
+	}
+	return top, true
+}
+
+// runSequential walks pages one at a time starting from p.startSkip,
+// persisting resume state after each successful page.
+func (p *Pager) runSequential(ctx context.Context, out chan<- DeclaredPerson) error {
+	skip := p.startSkip
+	for {
+		top, ok := p.pageTop(skip)
+		if !ok {
+			return nil
+		}
+
+		page, err := p.fetchPage(ctx, skip, top)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		for _, record := range page {
+			select {
+			case out <- record:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		skip += len(page)
+		if err := saveResumeState(p.params.Resume, skip); err != nil {
+			return fmt.Errorf("saving resume state: %w", err)
+		}
+		if len(page) < top {
+			return nil
+		}
+	}
+}
+
+// pageFetch is one worker's result for a dispatched $skip offset.
+type pageFetch struct {
+	skip    int
+	records []DeclaredPerson
+	err     error
+}
+
+// runParallel fans page fetches out across p.params.Parallel workers. A
+// dispatcher goroutine hands out $skip offsets in fixed-size strides; workers
+// stop being handed new offsets as soon as any page comes back short (the
+// end of the collection). Results are re-ordered by offset before being
+// written to out and before resume state advances, so both stay correct
+// under concurrency even though fetches complete out of order.
+func (p *Pager) runParallel(ctx context.Context, out chan<- DeclaredPerson) error {
+	jobs := make(chan int)
+	results := make(chan pageFetch)
+
+	var stopMu sync.Mutex
+	stopped := false
+	stop := func() {
+		stopMu.Lock()
+		stopped = true
+		stopMu.Unlock()
+	}
+	isStopped := func() bool {
+		stopMu.Lock()
+		defer stopMu.Unlock()
+		return stopped
+	}
+
+	// Dispatcher: hands out ever-increasing $skip offsets until the global
+	// limit is hit or a worker signals the collection has run dry.
+	go func() {
+		defer close(jobs)
+		skip := p.startSkip
+		for {
+			if isStopped() {
+				return
+			}
+			if _, ok := p.pageTop(skip); !ok {
+				return
+			}
+			select {
+			case jobs <- skip:
+				skip += p.pageSize
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.params.Parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for skip := range jobs {
+				top, ok := p.pageTop(skip)
+				if !ok {
+					continue
+				}
+				page, err := p.fetchPage(ctx, skip, top)
+				if err == nil && len(page) < top {
+					stop()
+				}
+				select {
+				case results <- pageFetch{skip: skip, records: page, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Pages can complete out of order, so buffer them until they can be
+	// flushed contiguously starting from nextSkip; that keeps both the
+	// output stream and the persisted resume offset correct.
+	pending := make(map[int][]DeclaredPerson)
+	nextSkip := p.startSkip
+	var firstErr error
+
+	flushReady := func() error {
+		for {
+			page, ok := pending[nextSkip]
+			if !ok {
+				return nil
+			}
+			for _, record := range page {
+				select {
+				case out <- record:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			delete(pending, nextSkip)
+			nextSkip += p.pageSize
+			if err := saveResumeState(p.params.Resume, nextSkip); err != nil {
+				return fmt.Errorf("saving resume state: %w", err)
+			}
+		}
+	}
+
+	for res := range results {
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+		pending[res.skip] = res.records
+		if err := flushReady(); err != nil {
+			return err
+		}
+	}
+
+	return firstErr
+}
+
+// fetchPage requests a single $skip/$top page, retrying transient failures
+// (network errors and 5xx responses) with exponential backoff and jitter.
+// A non-retryable (4xx) response is returned immediately.
+func (p *Pager) fetchPage(ctx context.Context, skip, top int) ([]DeclaredPerson, error) {
+	pageURL, err := buildQueryURL(p.params, skip, top)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < maxFetchAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoffWithJitter(attempt)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		var persons DeclaredPersons
+		status, err := GetJSON(p.client, pageURL, &persons)
+		if err == nil {
+			return persons.Value, nil
+		}
+		lastErr = err
+		if status != 0 && status < 500 {
+			// 4xx: retrying won't help.
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("fetching page at skip=%d after %d attempts: %w", skip, maxFetchAttempts, lastErr)
+}
+
+// backoffWithJitter returns the delay before retry attempt N (1-indexed),
+// doubling each time up to maxBackoff and adding up to 50% random jitter so
+// concurrent workers don't retry in lockstep.
+func backoffWithJitter(attempt int) time.Duration {
+	d := baseBackoff << uint(attempt-1)
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(d)/2 + 1))
+	return d/2 + jitter
+}
+
+// resumeState is the on-disk shape of a -resume file.
+type resumeState struct {
+	Skip int `json:"skip"`
+}
+
+// loadResumeState reads the last completed $skip offset from path. A missing
+// path or missing file both mean "start from the beginning".
+func loadResumeState(path string) (int, error) {
+	if path == "" {
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var state resumeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return 0, err
+	}
+	return state.Skip, nil
+}
+
+// saveResumeState persists the next $skip offset to fetch. It is a no-op
+// when path is empty.
+func saveResumeState(path string, skip int) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(resumeState{Skip: skip})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestBackoffWithJitterDoublesAndCaps(t *testing.T) {
+	for attempt := 1; attempt <= 10; attempt++ {
+		d := backoffWithJitter(attempt)
+		if d <= 0 {
+			t.Fatalf("backoffWithJitter(%d) = %v, want a positive delay", attempt, d)
+		}
+		if d > maxBackoff {
+			t.Fatalf("backoffWithJitter(%d) = %v, want it capped at %v", attempt, d, maxBackoff)
+		}
+	}
+}
+
+func TestBackoffWithJitterStaysWithinUnjitteredRange(t *testing.T) {
+	// d/2 (the floor set in the function) plus up to d/2 of jitter should
+	// never exceed the doubled, uncapped backoff for that attempt.
+	for attempt := 1; attempt <= 4; attempt++ {
+		want := baseBackoff << uint(attempt-1)
+		for i := 0; i < 20; i++ {
+			d := backoffWithJitter(attempt)
+			if d < want/2 {
+				t.Fatalf("backoffWithJitter(%d) = %v, want at least %v", attempt, d, want/2)
+			}
+			if d > want {
+				t.Fatalf("backoffWithJitter(%d) = %v, want at most %v", attempt, d, want)
+			}
+		}
+	}
+}
+
+func TestPageTopCapsToRemainingLimit(t *testing.T) {
+	p := &Pager{pageSize: 100, params: Parameters{Limit: 250}}
+
+	top, ok := p.pageTop(0)
+	if !ok || top != 100 {
+		t.Fatalf("pageTop(0) = (%d, %v), want (100, true)", top, ok)
+	}
+
+	top, ok = p.pageTop(200)
+	if !ok || top != 50 {
+		t.Fatalf("pageTop(200) = (%d, %v), want (50, true) since only 50 remain", top, ok)
+	}
+
+	top, ok = p.pageTop(250)
+	if ok {
+		t.Fatalf("pageTop(250) = (%d, %v), want ok=false once the limit is reached", top, ok)
+	}
+}
+
+func TestPageTopUncappedWhenLimitNegative(t *testing.T) {
+	p := &Pager{pageSize: 100, params: Parameters{Limit: -1}}
+
+	top, ok := p.pageTop(1000000)
+	if !ok || top != 100 {
+		t.Fatalf("pageTop(1000000) = (%d, %v), want (100, true) when Limit is -1 (no cap)", top, ok)
+	}
+}
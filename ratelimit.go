@@ -0,0 +1,58 @@
+package main
+
+import "time"
+
+// rateLimiter is a small token-bucket limiter for the HTTP server: it caps
+// the whole process to roughly ratePerSecond requests/sec across every
+// endpoint, refilling one token at a steady interval rather than all at once
+// so traffic gets smoothed instead of arriving in bursts.
+type rateLimiter struct {
+	tokens chan struct{}
+	stop   chan struct{}
+}
+
+// newRateLimiter starts a limiter allowing up to ratePerSecond Allow() calls
+// to succeed per second.
+func newRateLimiter(ratePerSecond int) *rateLimiter {
+	if ratePerSecond <= 0 {
+		ratePerSecond = 1
+	}
+
+	rl := &rateLimiter{
+		tokens: make(chan struct{}, ratePerSecond),
+		stop:   make(chan struct{}),
+	}
+	for i := 0; i < ratePerSecond; i++ {
+		rl.tokens <- struct{}{}
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second / time.Duration(ratePerSecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case rl.tokens <- struct{}{}:
+				default:
+					// Bucket is already full; drop this refill.
+				}
+			case <-rl.stop:
+				return
+			}
+		}
+	}()
+
+	return rl
+}
+
+// Allow reports whether a request may proceed right now, consuming a token
+// if so.
+func (rl *rateLimiter) Allow() bool {
+	select {
+	case <-rl.tokens:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Ahelios/DataRetrievalApp/output"
+	"github.com/Ahelios/DataRetrievalApp/store"
+)
+
+// serverRequestsPerSecond caps the whole server to roughly this many
+// requests/sec across all endpoints.
+const serverRequestsPerSecond = 20
+
+// runServer starts an HTTP server exposing /query, /metrics and /healthz.
+// base supplies the defaults (source, cache, serverGroup, ...) a run
+// started with -serve was given on the command line; each request can
+// override the filtering/grouping fields via query parameters. The
+// handlers call the same fetchGroupedRecords/buildOutputRecords functions
+// the one-shot CLI path uses, so serving never drifts from running once.
+// st is already open (nil if base.Cache is unset) and is shared across every
+// request for the server's whole lifetime, rather than each request opening
+// its own handle to the cache file.
+func runServer(addr string, base Parameters, client *http.Client, st *store.Store) error {
+	limiter := newRateLimiter(serverRequestsPerSecond)
+
+	names, err := loadDistrictNames(client, base.Source)
+	if err != nil {
+		fmt.Printf("Warning: could not load district names: %v\n", err)
+		names = map[int]string{}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/query", handleQuery(base, client, st, names))
+	mux.HandleFunc("/metrics", handleMetrics(base, client, st, names))
+
+	fmt.Printf("Listening on %s\n", addr)
+	return http.ListenAndServe(addr, rateLimited(limiter, mux))
+}
+
+func rateLimited(limiter *rateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.Allow() {
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "ok")
+}
+
+// paramsFromQuery overlays request query parameters (district, year, month,
+// day, group) onto base.
+func paramsFromQuery(base Parameters, query url.Values) (Parameters, error) {
+	params := base
+
+	params.Group = query.Get("group")
+	if params.Group == "" {
+		params.Group = "ym"
+	}
+
+	var err error
+	if params.District, err = queryInt(query, "district", params.District); err != nil {
+		return params, fmt.Errorf("invalid district: %w", err)
+	}
+	if params.Year, err = queryInt(query, "year", params.Year); err != nil {
+		return params, fmt.Errorf("invalid year: %w", err)
+	}
+	if params.Month, err = queryInt(query, "month", params.Month); err != nil {
+		return params, fmt.Errorf("invalid month: %w", err)
+	}
+	if params.Day, err = queryInt(query, "day", params.Day); err != nil {
+		return params, fmt.Errorf("invalid day: %w", err)
+	}
+
+	if params.District == 0 {
+		return params, fmt.Errorf("district query parameter is required")
+	}
+	return params, nil
+}
+
+func queryInt(query url.Values, key string, fallback int) (int, error) {
+	raw := query.Get(key)
+	if raw == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(raw)
+}
+
+// queryRecords runs the shared fetch+group pipeline for an HTTP request and
+// returns the resulting output.Records. The returned status is only
+// meaningful when err is non-nil: 400 for a bad request parameter, 502 for
+// an upstream/fetch failure.
+func queryRecords(r *http.Request, base Parameters, client *http.Client, st *store.Store, names map[int]string) ([]output.Record, int, error) {
+	params, err := paramsFromQuery(base, r.URL.Query())
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	grouped, _, districtName, err := fetchGroupedRecords(r.Context(), params, client, st, names)
+	if err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+
+	return buildOutputRecords(params, sortedGroups(grouped), districtName), 0, nil
+}
+
+func handleQuery(base Parameters, client *http.Client, st *store.Store, names map[int]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		records, status, err := queryRecords(r, base, client, st, names)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(records); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+func handleMetrics(base Parameters, client *http.Client, st *store.Store, names map[int]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		records, status, err := queryRecords(r, base, client, st, names)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		writer, err := output.New("prom", w)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := writer.Write(r.Context(), records); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package store provides an embedded BoltDB-backed cache of fetched
+// DeclaredPerson rows, plus a coverage index tracking which
+// (district, year, month) slices have already been pulled from the API so
+// a re-run only needs to ask for what's missing or stale.
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	recordsBucket  = "records"
+	coverageBucket = "coverage"
+)
+
+// Record mirrors the fields of main.DeclaredPerson that are worth caching.
+type Record struct {
+	ID           int    `json:"id"`
+	Year         int    `json:"year"`
+	Month        int    `json:"month"`
+	Day          int    `json:"day"`
+	Value        string `json:"value"`
+	DistrictID   int    `json:"district_id"`
+	DistrictName string `json:"district_name"`
+}
+
+// Slice identifies one (district, year, month) coverage unit: the
+// granularity at which the cache decides whether it needs to go back to
+// the API.
+type Slice struct {
+	DistrictID int
+	Year       int
+	Month      int
+}
+
+type coverageEntry struct {
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// Store is a BoltDB-backed cache. The zero value is not usable; create one
+// with Open.
+type Store struct {
+	db  *bbolt.DB
+	ttl time.Duration
+}
+
+// Open opens (creating if necessary) the cache database at path. ttl is how
+// long a slice's coverage is considered fresh; zero means coverage never
+// expires once recorded.
+func Open(path string, ttl time.Duration) (*Store, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening cache at %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(recordsBucket)); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists([]byte(coverageBucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db, ttl: ttl}, nil
+}
+
+// Close releases the underlying database file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func recordKey(r Record) []byte {
+	return []byte(fmt.Sprintf("%d|%04d|%02d|%02d|%d", r.DistrictID, r.Year, r.Month, r.Day, r.ID))
+}
+
+func sliceKey(s Slice) []byte {
+	return []byte(fmt.Sprintf("%d|%04d|%02d", s.DistrictID, s.Year, s.Month))
+}
+
+// Put upserts records into the cache, keyed by (district_id, year, month,
+// day, id).
+func (s *Store) Put(records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(recordsBucket))
+		for _, r := range records {
+			data, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(recordKey(r), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MarkFresh records that slice was fully fetched at fetchedAt, so later
+// Missing calls treat it as covered until the TTL elapses.
+func (s *Store) MarkFresh(slice Slice, fetchedAt time.Time) error {
+	data, err := json.Marshal(coverageEntry{FetchedAt: fetchedAt})
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(coverageBucket)).Put(sliceKey(slice), data)
+	})
+}
+
+// IsFresh reports whether slice has been fetched within the store's TTL.
+func (s *Store) IsFresh(slice Slice) (bool, error) {
+	var (
+		entry coverageEntry
+		found bool
+	)
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte(coverageBucket)).Get(sliceKey(slice))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &entry)
+	})
+	if err != nil || !found {
+		return false, err
+	}
+	if s.ttl <= 0 {
+		return true, nil
+	}
+	return time.Since(entry.FetchedAt) < s.ttl, nil
+}
+
+// Missing filters slices down to the ones that are not currently fresh,
+// i.e. the ones a caller still needs to fetch from the API.
+func (s *Store) Missing(slices []Slice) ([]Slice, error) {
+	missing := make([]Slice, 0, len(slices))
+	for _, slice := range slices {
+		fresh, err := s.IsFresh(slice)
+		if err != nil {
+			return nil, err
+		}
+		if !fresh {
+			missing = append(missing, slice)
+		}
+	}
+	return missing, nil
+}
+
+// Query returns cached records matching the given filters. A zero value for
+// any of districtID/year/month/day means "don't filter on this field".
+func (s *Store) Query(districtID, year, month, day int) ([]Record, error) {
+	var records []Record
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(recordsBucket)).ForEach(func(_, v []byte) error {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if districtID > 0 && r.DistrictID != districtID {
+				return nil
+			}
+			if year > 0 && r.Year != year {
+				return nil
+			}
+			if month > 0 && r.Month != month {
+				return nil
+			}
+			if day > 0 && r.Day != day {
+				return nil
+			}
+			records = append(records, r)
+			return nil
+		})
+	})
+	return records, err
+}
+
+// Prune deletes every cached slice (and the records belonging to it) whose
+// coverage was last fetched before olderThan ago, returning how many
+// records were removed.
+func (s *Store) Prune(olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan)
+	stale := make(map[string]bool)
+
+	removed := 0
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		coverage := tx.Bucket([]byte(coverageBucket))
+		cursor := coverage.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			var entry coverageEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if entry.FetchedAt.Before(cutoff) {
+				stale[string(k)] = true
+			}
+		}
+		for key := range stale {
+			if err := coverage.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		if len(stale) == 0 {
+			return nil
+		}
+
+		records := tx.Bucket([]byte(recordsBucket))
+		recordsCursor := records.Cursor()
+		for k, v := recordsCursor.First(); k != nil; k, v = recordsCursor.Next() {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			key := string(sliceKey(Slice{DistrictID: r.DistrictID, Year: r.Year, Month: r.Month}))
+			if !stale[key] {
+				continue
+			}
+			if err := recordsCursor.Delete(); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
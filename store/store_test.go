@@ -0,0 +1,118 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T, ttl time.Duration) *Store {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cache.db")
+	s, err := Open(path, ttl)
+	if err != nil {
+		t.Fatalf("Open() returned error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestPutAndQuery(t *testing.T) {
+	s := openTestStore(t, time.Hour)
+
+	records := []Record{
+		{ID: 1, DistrictID: 7, Year: 2019, Month: 3, Day: 1, Value: "10"},
+		{ID: 2, DistrictID: 7, Year: 2019, Month: 4, Day: 1, Value: "20"},
+		{ID: 3, DistrictID: 8, Year: 2019, Month: 3, Day: 1, Value: "30"},
+	}
+	if err := s.Put(records); err != nil {
+		t.Fatalf("Put() returned error: %v", err)
+	}
+
+	got, err := s.Query(7, 2019, 3, 0)
+	if err != nil {
+		t.Fatalf("Query() returned error: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != 1 {
+		t.Fatalf("Query(7, 2019, 3, 0) = %+v, want just record ID 1", got)
+	}
+
+	all, err := s.Query(7, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("Query() returned error: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("Query(7, 0, 0, 0) returned %d records, want 2", len(all))
+	}
+}
+
+func TestMissingHonorsTTL(t *testing.T) {
+	s := openTestStore(t, time.Millisecond)
+
+	slice := Slice{DistrictID: 7, Year: 2019, Month: 3}
+	missing, err := s.Missing([]Slice{slice})
+	if err != nil {
+		t.Fatalf("Missing() returned error: %v", err)
+	}
+	if len(missing) != 1 {
+		t.Fatalf("Missing() on an empty cache = %v, want the slice reported missing", missing)
+	}
+
+	if err := s.MarkFresh(slice, time.Now()); err != nil {
+		t.Fatalf("MarkFresh() returned error: %v", err)
+	}
+
+	missing, err = s.Missing([]Slice{slice})
+	if err != nil {
+		t.Fatalf("Missing() returned error: %v", err)
+	}
+	if len(missing) != 0 {
+		t.Fatalf("Missing() right after MarkFresh = %v, want none missing", missing)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	missing, err = s.Missing([]Slice{slice})
+	if err != nil {
+		t.Fatalf("Missing() returned error: %v", err)
+	}
+	if len(missing) != 1 {
+		t.Fatalf("Missing() after TTL expiry = %v, want the slice reported missing again", missing)
+	}
+}
+
+func TestPruneRemovesStaleSlicesOnly(t *testing.T) {
+	s := openTestStore(t, time.Hour)
+
+	stale := Slice{DistrictID: 7, Year: 2018, Month: 1}
+	fresh := Slice{DistrictID: 7, Year: 2019, Month: 1}
+
+	if err := s.Put([]Record{
+		{ID: 1, DistrictID: 7, Year: 2018, Month: 1, Day: 1, Value: "1"},
+		{ID: 2, DistrictID: 7, Year: 2019, Month: 1, Day: 1, Value: "2"},
+	}); err != nil {
+		t.Fatalf("Put() returned error: %v", err)
+	}
+	if err := s.MarkFresh(stale, time.Now().Add(-48*time.Hour)); err != nil {
+		t.Fatalf("MarkFresh() returned error: %v", err)
+	}
+	if err := s.MarkFresh(fresh, time.Now()); err != nil {
+		t.Fatalf("MarkFresh() returned error: %v", err)
+	}
+
+	removed, err := s.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("Prune() returned error: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("Prune() removed %d records, want 1", removed)
+	}
+
+	remaining, err := s.Query(7, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("Query() returned error: %v", err)
+	}
+	if len(remaining) != 1 || remaining[0].ID != 2 {
+		t.Fatalf("Query() after Prune() = %+v, want only record ID 2 left", remaining)
+	}
+}